@@ -11,30 +11,28 @@ package backdrop
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
+	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
 
 	"golang.org/x/net/context"
 )
 
+const (
+	// numShards - number of shards the request->context store is split
+	// across.  Each shard has its own lock, so requests that happen to
+	// hash to different shards never contend with one another.
+	numShards = 32
+)
+
 var (
-	// fetchCtx - private package ctx message channel
-	fetchCtx chan fetchCtxMessage
-	// setCtx - private package ctx message channel
-	setCtx chan setCtxMessage
-	// fetch - private package ctx message channel
-	fetch chan valueMessage
-	// set - private package ctx message channel
-	set chan valueMessage
-	// kill - private package ctx message channel
-	kill chan killMessage
-	// stopped - private package ctx message channel
-	stopped chan bool
 	// initOnce - make sure we only initialize once
 	initOnce = sync.Once{}
-	// contexts - global map of contexts
-	contexts map[*http.Request]context.Context
+	// store - global sharded map of contexts
+	store *backdropStore
 	// ErrSettingToBackdrop - error when backdrop Set() is unable to set
 	ErrSettingToBackdrop = errors.New("failed to set variable to backdrop")
 	// ErrGettingFromBackdrop - error when backdrop Get() is unable to get
@@ -44,47 +42,259 @@ var (
 )
 
 const (
-	// workerDoneKey - this is the global context key for when to end the workers
-	workerDoneKey int = iota
 	// cancelKey - this is the global key for cancel function
-	cancelKey
+	cancelKey int = iota
 )
 
-// ctxMessage - a message structure for channel communications
-type setCtxMessage struct {
-	Request   *http.Request
-	Context   context.Context
-	RespondTo chan error
+// done - a context.CancelFunc variable to override
+var done func()
+
+// entry - a context plus the time it was created, so a sweep can tell how
+// long it's been sitting in the store
+type entry struct {
+	ctx       context.Context
+	createdAt time.Time
 }
 
-// fetchCtxMessage - a message structure for channel communications
-type fetchCtxMessage struct {
-	Request   *http.Request
-	RespondTo chan context.Context
+// reqKey - identifies a request by its pointer value without holding onto
+// the pointer itself, so storing a reqKey as a map key doesn't keep the
+// *http.Request it came from reachable.  This is what lets watchForLeak's
+// finalizer ever actually fire: if the map held *http.Request directly, the
+// map would itself be a strong reference and the request could never be
+// considered unreachable while its entry sits in the store.
+type reqKey uintptr
+
+// keyFor - compute the reqKey for a request
+func keyFor(r *http.Request) reqKey {
+	return reqKey(uintptr(unsafe.Pointer(r)))
 }
 
-// killMessage - a message structure for channel communications
-type killMessage struct {
-	Request   *http.Request
-	RespondTo chan error
+// shard - a single slice of the backdrop store, guarded by its own lock so
+// that unrelated requests never block each other.
+type shard struct {
+	mu sync.RWMutex
+	m  map[reqKey]entry
 }
 
-// valueMessage - a message structure for channel communications
-type valueMessage struct {
-	Request   *http.Request
-	Key       interface{}
-	Value     interface{}
-	RespondTo chan interface{}
+// backdropStore - the sharded, lock-per-shard replacement for the old
+// single worker goroutine + channel design.  Every exported function below
+// talks to this store directly instead of round tripping through a
+// serializing worker.
+type backdropStore struct {
+	baseCtx context.Context
+	shards  [numShards]*shard
+	maxAge  time.Duration
+
+	// leakedReaped - count of entries the sweep found past MaxAge and
+	// reaped itself, rather than having been Evict()ed by the caller
+	leakedReaped uint64
+	// sweepHalt - closed by Stop to end the sweep goroutine, if running
+	sweepHalt chan struct{}
 }
 
-// done - a context.CancelFunc variable to override
-var done func()
+// newBackdropStore - allocate a store with all of its shards ready to use
+func newBackdropStore(baseCtx context.Context, maxAge time.Duration) *backdropStore {
+	s := &backdropStore{baseCtx: baseCtx, maxAge: maxAge, sweepHalt: make(chan struct{})}
+	for i := range s.shards {
+		s.shards[i] = &shard{m: make(map[reqKey]entry)}
+	}
+	return s
+}
+
+// watchForLeak - arrange for key's entry to be reaped if r is garbage
+// collected without ever going through Evict.  Because the store keys its
+// map by reqKey rather than by *http.Request itself, the map holds no
+// strong reference to r, so r becomes unreachable (and this finalizer
+// fires) as soon as the caller's own references to it are dropped, unless
+// evict has already removed the finalizer.  The MaxAge sweep (see
+// reapOlderThan) is a second, independent backstop for entries that
+// outlive their request but haven't been collected yet.
+func (s *backdropStore) watchForLeak(r *http.Request, key reqKey) {
+	runtime.SetFinalizer(r, func(*http.Request) {
+		sh := s.shardForKey(key)
+		sh.mu.Lock()
+		e, ok := sh.m[key]
+		if ok {
+			delete(sh.m, key)
+		}
+		sh.mu.Unlock()
+		if !ok {
+			return
+		}
+		if cancel, ok := e.ctx.Value(cancelKey).(context.CancelFunc); ok {
+			cancel()
+		}
+		atomic.AddUint64(&s.leakedReaped, 1)
+	})
+}
+
+// reapOlderThan - cancel and remove every entry older than maxAge.  Called
+// periodically by the sweep goroutine started when Options.MaxAge and
+// Options.SweepInterval are both set.
+func (s *backdropStore) reapOlderThan(maxAge time.Duration) {
+	now := time.Now()
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for key, e := range sh.m {
+			if now.Sub(e.createdAt) <= maxAge {
+				continue
+			}
+			if cancel, ok := e.ctx.Value(cancelKey).(context.CancelFunc); ok {
+				cancel()
+			}
+			delete(sh.m, key)
+			atomic.AddUint64(&s.leakedReaped, 1)
+		}
+		sh.mu.Unlock()
+	}
+}
+
+// sweep - periodically reap entries older than maxAge, until sweepHalt is
+// closed
+func (s *backdropStore) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.sweepHalt:
+			return
+		case <-ticker.C:
+			s.reapOlderThan(s.maxAge)
+		}
+	}
+}
+
+// shardForKey - pick the shard a reqKey lives in
+func (s *backdropStore) shardForKey(key reqKey) *shard {
+	// shift off the low, alignment-determined bits so the shard choice
+	// isn't skewed by the allocator always handing out aligned addresses
+	return s.shards[(uintptr(key)>>4)%numShards]
+}
+
+// getOrCreate - fetch the context for a request, creating a fresh,
+// cancelable one rooted at baseCtx if this is the first time we've seen it
+func (s *backdropStore) getOrCreate(r *http.Request) context.Context {
+	key := keyFor(r)
+	sh := s.shardForKey(key)
+
+	sh.mu.RLock()
+	e, ok := sh.m[key]
+	sh.mu.RUnlock()
+	if ok && e.ctx != nil {
+		return e.ctx
+	}
+
+	sh.mu.Lock()
+	if e, ok := sh.m[key]; ok && e.ctx != nil {
+		sh.mu.Unlock()
+		return e.ctx
+	}
+	ctx, cancel := context.WithCancel(s.baseCtx)
+	ctx = context.WithValue(ctx, cancelKey, cancel)
+	sh.m[key] = entry{ctx: ctx, createdAt: time.Now()}
+	sh.mu.Unlock()
+	s.watchForLeak(r, key)
+	return ctx
+}
+
+// setValue - attach a key/value pair to a request's context, creating the
+// context if one doesn't exist yet
+func (s *backdropStore) setValue(r *http.Request, k, v interface{}) context.Context {
+	key := keyFor(r)
+	sh := s.shardForKey(key)
+
+	sh.mu.Lock()
+	if e, ok := sh.m[key]; ok && e.ctx != nil {
+		ctx := context.WithValue(e.ctx, k, v)
+		sh.m[key] = entry{ctx: ctx, createdAt: e.createdAt}
+		sh.mu.Unlock()
+		return ctx
+	}
+	ctx, cancel := context.WithCancel(s.baseCtx)
+	ctx = context.WithValue(ctx, k, v)
+	ctx = context.WithValue(ctx, cancelKey, cancel)
+	sh.m[key] = entry{ctx: ctx, createdAt: time.Now()}
+	sh.mu.Unlock()
+	s.watchForLeak(r, key)
+	return ctx
+}
+
+// setContext - replace a request's context outright, only if one already
+// exists for it (mirrors the previous worker's semantics).
+//
+// If ctx already carries a cancelKey through its ancestry, it is stored
+// as-is.  That is the case when ctx is derived from the entry being
+// replaced (e.g. the WithTimeout/WithDeadline/WithCancel helpers, which
+// call context.With*(GetContext(r), ...) before calling SetContext), and
+// also when it is derived from any other request's backdrop context; which
+// entry the cancelKey came from is not checked.
+// Otherwise ctx carries no backdrop cancelKey at all - the stale
+// cancelCtx is released immediately (it would otherwise sit forever as a
+// child of baseCtx, since nothing else will ever cancel it) and the
+// replacement is given its own cancelable wrapper so Evict still works.
+func (s *backdropStore) setContext(r *http.Request, ctx context.Context) {
+	key := keyFor(r)
+	sh := s.shardForKey(key)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	e, exists := sh.m[key]
+	if !exists {
+		return
+	}
+
+	if ctx.Value(cancelKey) != nil {
+		sh.m[key] = entry{ctx: ctx, createdAt: e.createdAt}
+		return
+	}
+
+	if oldCancel, ok := e.ctx.Value(cancelKey).(context.CancelFunc); ok {
+		oldCancel()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	ctx = context.WithValue(ctx, cancelKey, cancel)
+	sh.m[key] = entry{ctx: ctx, createdAt: e.createdAt}
+}
+
+// evict - cancel and remove a request's context, if one exists
+func (s *backdropStore) evict(r *http.Request) {
+	key := keyFor(r)
+	sh := s.shardForKey(key)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	e, ok := sh.m[key]
+	if !ok || e.ctx == nil {
+		return
+	}
+	if v := e.ctx.Value(cancelKey); v != nil {
+		if cancel, ok := v.(context.CancelFunc); ok {
+			cancel()
+			<-e.ctx.Done()
+		}
+	}
+	delete(sh.m, key)
+	runtime.SetFinalizer(r, nil)
+}
 
 // Options - structure that defines the options for Start
 type Options struct {
+	// BufferSize - Deprecated: unused now that the store is sharded
+	// instead of channel-fed; retained for source compatibility.
 	BufferSize int
+	// NumWorkers - Deprecated: unused now that the store is sharded
+	// instead of channel-fed; retained for source compatibility.
 	NumWorkers int
 	Context    context.Context
+
+	// MaxAge - if set along with SweepInterval, entries older than
+	// MaxAge are canceled and reaped automatically, so a handler that
+	// panics or otherwise never reaches ClearContextHandler/Evict can't
+	// leak its context forever.
+	MaxAge time.Duration
+	// SweepInterval - how often to look for entries past MaxAge. Has no
+	// effect unless MaxAge is also set.
+	SweepInterval time.Duration
 }
 
 // NewOptions - create new options
@@ -116,7 +326,7 @@ func Start(options *Options) {
 		options = NewOptions(nil, 0, 0)
 	}
 	options.SaneDefaults()
-	startBackdrop(options.Context, options.NumWorkers, options.BufferSize)
+	startBackdrop(options.Context, options.MaxAge, options.SweepInterval)
 }
 
 // Stop - create a new context backdrop for http requests contexts
@@ -141,45 +351,24 @@ func (hw *ClearContextHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 
 // Evict - Evict a request's context
 func Evict(r *http.Request) error {
-	err := make(chan error)
-	kill <- killMessage{
-		Request:   r,
-		RespondTo: err,
-	}
-	return <-err
+	store.evict(r)
+	return nil
 }
 
 // GetContext - get the context associated with the request
 func GetContext(r *http.Request) context.Context {
-	ctx := make(chan context.Context)
-	fetchCtx <- fetchCtxMessage{
-		Request:   r,
-		RespondTo: ctx,
-	}
-	return <-ctx
+	return store.getOrCreate(r)
 }
 
 // SetContext - set the context associated with the request
 func SetContext(r *http.Request, ctx context.Context) error {
-	err := make(chan error)
-	setCtx <- setCtxMessage{
-		Request:   r,
-		Context:   ctx,
-		RespondTo: err,
-	}
-	return <-err
+	store.setContext(r, ctx)
+	return nil
 }
 
 // Set - Set a variable k/v pair onto the request's context
 func Set(r *http.Request, k interface{}, v interface{}) error {
-	response := make(chan interface{})
-	set <- valueMessage{
-		Request:   r,
-		Key:       k,
-		Value:     v,
-		RespondTo: response,
-	}
-	if r := <-response; r == nil {
+	if ctx := store.setValue(r, k, v); ctx == nil {
 		return ErrSettingToBackdrop
 	}
 	return nil
@@ -187,146 +376,62 @@ func Set(r *http.Request, k interface{}, v interface{}) error {
 
 // Get - Get a variable k/v pair from the request's context
 func Get(r *http.Request, k interface{}) (interface{}, error) {
-	response := make(chan interface{})
-	fetch <- valueMessage{
-		Request:   r,
-		Key:       k,
-		RespondTo: response,
+	ctx := store.getExisting(r)
+	if ctx == nil {
+		return nil, ErrGettingFromBackdrop
 	}
-	value := <-response
+	value := ctx.Value(k)
 	if value == nil {
 		return nil, ErrGettingFromBackdrop
 	}
 	return value, nil
 }
 
+// getExisting - fetch a request's context without creating one
+func (s *backdropStore) getExisting(r *http.Request) context.Context {
+	key := keyFor(r)
+	sh := s.shardForKey(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	return sh.m[key].ctx
+}
+
 // startBackdrop - Initalize our backdrop
-func startBackdrop(ctx context.Context, workers, bufferSize int) {
+func startBackdrop(ctx context.Context, maxAge, sweepInterval time.Duration) {
 	initOnce.Do(func() {
-		// our operations will be fetch, set, and kill,
-		fetchCtx = make(chan fetchCtxMessage, bufferSize)
-		setCtx = make(chan setCtxMessage, bufferSize)
-		fetch = make(chan valueMessage, bufferSize)
-		set = make(chan valueMessage, bufferSize)
-		kill = make(chan killMessage, bufferSize)
-		stopped = make(chan bool, workers)
-
-		contexts = make(map[*http.Request]context.Context)
-
-		// set initial context for global context
 		if ctx == nil {
 			ctx = context.Background()
 		}
-		ctx, done = context.WithCancel(ctx)
+		var baseCtx context.Context
+		baseCtx, done = context.WithCancel(ctx)
 
-		// setup our worker pool, collect the channels
-		var workerChannels []chan bool
-		for i := 0; i < workers; i++ {
-			workerChannels = append(workerChannels, make(chan bool))
-			go worker(ctx, workerChannels[len(workerChannels)-1])
-		}
+		store = newBackdropStore(baseCtx, maxAge)
 
-		go func() {
-			// if we get word that the global context should die, stop the workers
-			<-ctx.Done()
-			for _, halt := range workerChannels {
-				halt <- true
-			}
-		}()
+		if maxAge > 0 && sweepInterval > 0 {
+			go store.sweep(sweepInterval)
+		}
 
 		Stop = func() {
 			done()
-			for _ = range workerChannels {
-				<-stopped
-			}
+			close(store.sweepHalt)
 		}
 	})
 }
 
-// worker - a worker who will fetch/set to the global context as needed.
-func worker(baseCtx context.Context, halt chan bool) {
-Loop:
-	for {
-		select {
-
-		case <-halt:
-			// finish this worker
-			break Loop
-
-		case message := <-fetchCtx:
-			// fetch the context alone
-			if ctx, ok := contexts[message.Request]; ok && ctx != nil {
-				// if there is a request context, grab the message key from it and reply
-				message.RespondTo <- ctx
-				continue
-			}
-			// a context was never created for this request, create a cancel
-			// context for the caller
-			ctx, cancel := context.WithCancel(baseCtx)
-			ctx = context.WithValue(ctx, cancelKey, cancel)
-			// set this request context on the global context
-			contexts[message.Request] = ctx
-			// reply to note set is finished
-			message.RespondTo <- ctx
-
-		case message := <-fetch:
-			// fetch a value from the context
-			if ctx, ok := contexts[message.Request]; ok && ctx != nil {
-				// if there is a request context, grab the message key from it and reply
-				message.RespondTo <- ctx.Value(message.Key)
-				continue
-			}
-			message.RespondTo <- nil
-
-		case message := <-kill:
-			// evict the context from the map
-			if v, exists := contexts[message.Request]; exists {
-				fmt.Println(exists, contexts)
-				if ctx, ok := v.(context.Context); ok && ctx != nil {
-
-					fmt.Println("here, ctx: ", ctx)
-
-					// if there is a request context, use it's cancel function to end that context
-					if v := ctx.Value(cancelKey); v != nil {
-						if cancel, ok := v.(context.CancelFunc); ok {
-							cancel()
-							<-ctx.Done()
-							delete(contexts, message.Request)
-						}
-					}
-				}
-			}
-			message.RespondTo <- nil
+// StoreStats - counters describing the health of the backdrop store
+type StoreStats struct {
+	// LeakedReaped - number of entries that were canceled and removed by
+	// the MaxAge sweep or the finalizer backstop, rather than by an
+	// explicit Evict/ClearContextHandler.  A non-zero count here means
+	// some handler path is missing a ClearContextHandler wrapper.
+	LeakedReaped uint64
+}
 
-		case message := <-setCtx:
-			// set the context outright
-			if _, exists := contexts[message.Request]; exists {
-				contexts[message.Request] = message.Context
-			}
-			message.RespondTo <- nil
-
-		case message := <-set:
-			// set a value on the context
-			// get on the global for the request specific context
-			if ctx, ok := contexts[message.Request]; ok && ctx != nil {
-				// set the key to the existing context
-				ctx = context.WithValue(ctx, message.Key, message.Value)
-				contexts[message.Request] = ctx
-				message.RespondTo <- ctx
-				continue
-			}
-			ctx, cancel := context.WithCancel(baseCtx)
-			// add our value to the request context associated with our key
-			ctx = context.WithValue(ctx, message.Key, message.Value)
-			// create a cancelable context, with the cancel function on said context
-			// for easy access
-			ctx = context.WithValue(ctx, cancelKey, cancel)
-
-			// set this request context on the global context
-			contexts[message.Request] = ctx
-			// reply to note set is finished
-			message.RespondTo <- ctx
-		}
+// Stats - snapshot of the current backdrop store's counters.  Returns a
+// zero-valued StoreStats if called before Start.
+func Stats() StoreStats {
+	if store == nil {
+		return StoreStats{}
 	}
-	stopped <- true
+	return StoreStats{LeakedReaped: atomic.LoadUint64(&store.leakedReaped)}
 }
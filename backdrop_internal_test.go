@@ -0,0 +1,139 @@
+// Copyright 2015 - Husobee Associates, LLC.  All rights reserved.
+// Use of this source code is governed by The MIT License, which can be found
+// in the LICENSE file included.
+
+package backdrop
+
+import (
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// TestReapOlderThan exercises the MaxAge sweep directly against a
+// freestanding store, since the package's Start is a process-wide
+// sync.Once and can't be re-initialized with different options once
+// another test has already called it.
+func TestReapOlderThan(t *testing.T) {
+	s := newBackdropStore(context.Background(), time.Millisecond)
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	key := keyFor(r)
+	ctx, cancel := context.WithCancel(s.baseCtx)
+	ctx = context.WithValue(ctx, cancelKey, cancel)
+	sh := s.shardForKey(key)
+	sh.m[key] = entry{ctx: ctx, createdAt: time.Now().Add(-time.Hour)}
+
+	s.reapOlderThan(time.Millisecond)
+
+	sh.mu.RLock()
+	_, stillPresent := sh.m[key]
+	sh.mu.RUnlock()
+	if stillPresent {
+		t.Error("expected stale entry to be reaped")
+	}
+	select {
+	case <-ctx.Done():
+	default:
+		t.Error("expected reaped entry's context to be canceled")
+	}
+	if got := s.leakedReaped; got != 1 {
+		t.Errorf("expected leakedReaped to be 1, got %d", got)
+	}
+}
+
+// TestWatchForLeakFinalizerFires proves the finalizer backstop can actually
+// run: a request whose entry is never evicted must still be collectible,
+// and collecting it must reap the entry and bump Stats().LeakedReaped.
+// This only holds because the store keys its map by reqKey rather than by
+// *http.Request - see the comment on reqKey.
+func TestWatchForLeakFinalizerFires(t *testing.T) {
+	s := newBackdropStore(context.Background(), time.Hour)
+
+	func() {
+		r, _ := http.NewRequest("GET", "/", nil)
+		s.getOrCreate(r)
+		// r deliberately goes out of scope here without ever being
+		// evicted, simulating a handler that panics or forgets
+		// ClearContextHandler.
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		runtime.GC()
+		if atomic.LoadUint64(&s.leakedReaped) > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("expected the finalizer to reap the leaked request's entry")
+}
+
+// TestSetContextReleasesStaleCancelOnReplace covers the case
+// setContext is built for: the replacement context has no relation at all
+// to what's being replaced (e.g. a raw incoming gRPC ctx).  The stale
+// cancelCtx must be released right away instead of leaking as a permanent
+// child of baseCtx, and the replacement must still be evictable afterward.
+func TestSetContextReleasesStaleCancelOnReplace(t *testing.T) {
+	s := newBackdropStore(context.Background(), time.Hour)
+	r, _ := http.NewRequest("GET", "/", nil)
+
+	oldCtx := s.getOrCreate(r)
+
+	s.setContext(r, context.Background())
+
+	select {
+	case <-oldCtx.Done():
+	default:
+		t.Error("expected the stale context to be canceled once replaced by an unrelated context")
+	}
+
+	newCtx := s.getExisting(r)
+	if newCtx == nil {
+		t.Fatal("expected the replacement context to still be tracked")
+	}
+	select {
+	case <-newCtx.Done():
+		t.Error("replacement context should still be live immediately after setContext")
+	default:
+	}
+
+	s.evict(r)
+	select {
+	case <-newCtx.Done():
+	default:
+		t.Error("expected Evict to be able to cancel the replacement context")
+	}
+}
+
+// TestSetContextPreservesDerivedContext covers the WithTimeout/WithDeadline/
+// WithCancel usage pattern: the replacement context is itself derived from
+// the one already stored, so it already carries cancelKey through its own
+// ancestry.  setContext must not cancel the original out from under it.
+func TestSetContextPreservesDerivedContext(t *testing.T) {
+	s := newBackdropStore(context.Background(), time.Hour)
+	r, _ := http.NewRequest("GET", "/", nil)
+
+	base := s.getOrCreate(r)
+	derived, cancel := context.WithCancel(base)
+	defer cancel()
+
+	s.setContext(r, derived)
+
+	select {
+	case <-base.Done():
+		t.Error("did not expect the original context to be canceled when replaced by one derived from it")
+	default:
+	}
+
+	s.evict(r)
+	select {
+	case <-derived.Done():
+	default:
+		t.Error("expected Evict to cancel the derived replacement context")
+	}
+}
@@ -53,6 +53,20 @@ func TestClearContextHandler(t *testing.T) {
 	}
 }
 
+func TestStatsNotIncrementedByExplicitEvict(t *testing.T) {
+	backdrop.Start(nil)
+	r, _ := http.NewRequest("GET", "/", nil)
+	backdrop.Set(r, "test", "testing")
+
+	before := backdrop.Stats().LeakedReaped
+	backdrop.Evict(r)
+	after := backdrop.Stats().LeakedReaped
+
+	if after != before {
+		t.Errorf("explicit Evict should not count as a leak, got %d leaked before and %d after", before, after)
+	}
+}
+
 func BenchmarkBackdropSet(b *testing.B) {
 	backdrop.Start(nil)
 	done := make(chan bool)
@@ -83,3 +97,37 @@ func BenchmarkBackdropGet(b *testing.B) {
 		<-done
 	}
 }
+
+// BenchmarkBackdropSetSameRequest - every goroutine contends on the same
+// request, so all traffic lands on a single shard.  This is the worst case
+// for the sharded store, and is roughly the contention pattern the old
+// single channel+worker implementation forced on every caller all the
+// time.  NOTE: that old implementation was removed rather than kept side
+// by side, so this is not a direct before/after comparison - only the two
+// contention patterns below, against the new store, are benchmarked here.
+func BenchmarkBackdropSetSameRequest(b *testing.B) {
+	backdrop.Start(nil)
+	r, _ := http.NewRequest("GET", "/", nil)
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			backdrop.Set(r, i, "testing")
+			i++
+		}
+	})
+}
+
+// BenchmarkBackdropSetDistinctRequests - each goroutine owns its own
+// request, so traffic spreads across shards and locks stop being shared.
+// This is the case the sharded store was built to make fast.
+func BenchmarkBackdropSetDistinctRequests(b *testing.B) {
+	backdrop.Start(nil)
+	b.RunParallel(func(pb *testing.PB) {
+		r, _ := http.NewRequest("GET", "/", nil)
+		i := 0
+		for pb.Next() {
+			backdrop.Set(r, i, "testing")
+			i++
+		}
+	})
+}
@@ -0,0 +1,54 @@
+// Copyright 2015 - Husobee Associates, LLC.  All rights reserved.
+// Use of this source code is governed by The MIT License, which can be found
+// in the LICENSE file included.
+
+// Package ctxhttp - outbound HTTP calls that inherit an inbound request's
+// backdrop context, in the same shape as golang.org/x/net/context/ctxhttp.
+// Given the inbound request a handler is serving and the outbound request
+// it wants to make on that handler's behalf, these helpers make sure
+// canceling or timing out the inbound request's context tears down the
+// outbound call too.
+package ctxhttp
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/husobee/backdrop"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// Do - send outbound via client, canceling it if inbound's backdrop context
+// is done before the response comes back.  If client is nil,
+// http.DefaultClient is used.
+func Do(inbound *http.Request, client *http.Client, outbound *http.Request) (*http.Response, error) {
+	return ctxhttp.Do(backdrop.GetContext(inbound), client, outbound)
+}
+
+// Get - issue a GET to url, canceling it if inbound's backdrop context is
+// done before the response comes back.
+func Get(inbound *http.Request, client *http.Client, url string) (*http.Response, error) {
+	return ctxhttp.Get(backdrop.GetContext(inbound), client, url)
+}
+
+// Head - issue a HEAD to url, canceling it if inbound's backdrop context is
+// done before the response comes back.
+func Head(inbound *http.Request, client *http.Client, url string) (*http.Response, error) {
+	return ctxhttp.Head(backdrop.GetContext(inbound), client, url)
+}
+
+// Post - issue a POST to url with the given body and content type,
+// canceling it if inbound's backdrop context is done before the response
+// comes back.
+func Post(inbound *http.Request, client *http.Client, url, bodyType string, body io.Reader) (*http.Response, error) {
+	return ctxhttp.Post(backdrop.GetContext(inbound), client, url, bodyType, body)
+}
+
+// PostForm - issue a POST to url with data's keys and values URL-encoded as
+// the request body, canceling it if inbound's backdrop context is done
+// before the response comes back.
+func PostForm(inbound *http.Request, client *http.Client, url string, data url.Values) (*http.Response, error) {
+	return Post(inbound, client, url, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+}
@@ -0,0 +1,58 @@
+package ctxhttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/husobee/backdrop"
+	"github.com/husobee/backdrop/ctxhttp"
+)
+
+func TestGetCanceledByInboundContext(t *testing.T) {
+	backdrop.Start(nil)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	inbound, _ := http.NewRequest("GET", "/", nil)
+	cancel, err := backdrop.WithTimeout(inbound, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal("failed to set up inbound timeout: ", err)
+	}
+	defer cancel()
+	defer backdrop.Evict(inbound)
+
+	if _, err := ctxhttp.Get(inbound, http.DefaultClient, server.URL); err == nil {
+		t.Error("expected the slow outbound request to be canceled by the inbound request's backdrop timeout")
+	}
+}
+
+func TestGetSucceedsWithinDeadline(t *testing.T) {
+	backdrop.Start(nil)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	inbound, _ := http.NewRequest("GET", "/", nil)
+	cancel, err := backdrop.WithTimeout(inbound, time.Second)
+	if err != nil {
+		t.Fatal("failed to set up inbound timeout: ", err)
+	}
+	defer cancel()
+	defer backdrop.Evict(inbound)
+
+	resp, err := ctxhttp.Get(inbound, http.DefaultClient, server.URL)
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 - Husobee Associates, LLC.  All rights reserved.
+// Use of this source code is governed by The MIT License, which can be found
+// in the LICENSE file included.
+
+// Package grpcbackdrop - gRPC interceptors that bridge a request's
+// backdrop context to outbound RPCs, and an incoming RPC's context into
+// backdrop, so mixed HTTP+gRPC services can share value lookups and have
+// canceling the HTTP request tear down any in-flight RPCs it started.
+package grpcbackdrop
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/husobee/backdrop"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// requestKey - context key the synthetic *http.Request is stashed under by
+// UnaryServerInterceptor
+type requestKey struct{}
+
+// mergeContext - take the ctx the caller handed to the RPC and the ctx
+// backdrop is holding for the request, and produce one context that
+// carries backdrop's cancellation/deadline plus the caller's outgoing
+// metadata.  The returned CancelFunc must be called once the RPC is done.
+func mergeContext(callCtx, backdropCtx context.Context) (context.Context, context.CancelFunc) {
+	ctx := backdropCtx
+	if md, ok := metadata.FromOutgoingContext(callCtx); ok {
+		ctx = metadata.NewOutgoingContext(ctx, md)
+	}
+	if deadline, ok := callCtx.Deadline(); ok {
+		return context.WithDeadline(ctx, deadline)
+	}
+	return context.WithCancel(ctx)
+}
+
+// UnaryClientInterceptor - replace the ctx of every outbound unary RPC with
+// one derived from backdrop.GetContext(r), so canceling r tears down the
+// RPC too.
+func UnaryClientInterceptor(r *http.Request) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		mergedCtx, cancel := mergeContext(ctx, backdrop.GetContext(r))
+		defer cancel()
+		return invoker(mergedCtx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor - replace the ctx of every outbound streaming RPC
+// with one derived from backdrop.GetContext(r), so canceling r tears down
+// the stream too.  The merged context is released as soon as the stream
+// itself finishes, rather than lingering for the life of r.
+func StreamClientInterceptor(r *http.Request) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		mergedCtx, cancel := mergeContext(ctx, backdrop.GetContext(r))
+		stream, err := streamer(mergedCtx, desc, cc, method, opts...)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		return &cancelingClientStream{ClientStream: stream, cancel: cancel}, nil
+	}
+}
+
+// cancelingClientStream - a grpc.ClientStream that releases its merged
+// context's CancelFunc as soon as RecvMsg reports the stream is done
+// (a real message error or the terminal io.EOF), instead of waiting for r's
+// own context to be canceled or evicted.
+type cancelingClientStream struct {
+	grpc.ClientStream
+	cancel     context.CancelFunc
+	cancelOnce sync.Once
+}
+
+// RecvMsg - implementation of grpc.ClientStream
+func (s *cancelingClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.cancelOnce.Do(s.cancel)
+	}
+	return err
+}
+
+// UnaryServerInterceptor - store the incoming RPC's ctx into backdrop,
+// keyed by a synthetic *http.Request scoped to this call, so handlers that
+// also deal in *http.Request can look up the same values through backdrop.
+// The synthetic request is reachable from the handler's ctx via
+// RequestFromContext.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		r, err := http.NewRequest("GRPC", info.FullMethod, nil)
+		if err != nil {
+			return handler(ctx, req)
+		}
+		backdrop.GetContext(r)
+		if err := backdrop.SetContext(r, ctx); err != nil {
+			return handler(ctx, req)
+		}
+		defer backdrop.Evict(r)
+		return handler(context.WithValue(ctx, requestKey{}, r), req)
+	}
+}
+
+// RequestFromContext - retrieve the synthetic *http.Request backdrop
+// associated with the current gRPC call, as installed by
+// UnaryServerInterceptor.
+func RequestFromContext(ctx context.Context) (*http.Request, bool) {
+	r, ok := ctx.Value(requestKey{}).(*http.Request)
+	return r, ok
+}
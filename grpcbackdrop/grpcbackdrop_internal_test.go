@@ -0,0 +1,76 @@
+// Copyright 2015 - Husobee Associates, LLC.  All rights reserved.
+// Use of this source code is governed by The MIT License, which can be found
+// in the LICENSE file included.
+
+package grpcbackdrop
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestMergeContextUsesNearerDeadline(t *testing.T) {
+	backdropCtx, backdropCancel := context.WithTimeout(context.Background(), time.Hour)
+	defer backdropCancel()
+
+	callCtx, callCancel := context.WithTimeout(context.Background(), time.Minute)
+	defer callCancel()
+
+	merged, cancel := mergeContext(callCtx, backdropCtx)
+	defer cancel()
+
+	deadline, ok := merged.Deadline()
+	if !ok {
+		t.Fatal("expected merged context to carry a deadline")
+	}
+	wantDeadline, _ := callCtx.Deadline()
+	if !deadline.Equal(wantDeadline) {
+		t.Errorf("expected merged deadline to match the call's nearer deadline %v, got %v", wantDeadline, deadline)
+	}
+}
+
+func TestMergeContextKeepsBackdropDeadlineWhenCallHasNone(t *testing.T) {
+	backdropCtx, backdropCancel := context.WithTimeout(context.Background(), time.Minute)
+	defer backdropCancel()
+
+	merged, cancel := mergeContext(context.Background(), backdropCtx)
+	defer cancel()
+
+	deadline, ok := merged.Deadline()
+	if !ok {
+		t.Fatal("expected merged context to inherit backdrop's deadline")
+	}
+	wantDeadline, _ := backdropCtx.Deadline()
+	if !deadline.Equal(wantDeadline) {
+		t.Errorf("expected merged deadline %v, got %v", wantDeadline, deadline)
+	}
+}
+
+func TestMergeContextCarriesOutgoingMetadata(t *testing.T) {
+	callCtx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("key", "value"))
+
+	merged, cancel := mergeContext(callCtx, context.Background())
+	defer cancel()
+
+	md, ok := metadata.FromOutgoingContext(merged)
+	if !ok || len(md.Get("key")) != 1 || md.Get("key")[0] != "value" {
+		t.Error("expected merged context to carry the call's outgoing metadata")
+	}
+}
+
+func TestMergeContextCancelTearsDownMerged(t *testing.T) {
+	backdropCtx, backdropCancel := context.WithCancel(context.Background())
+	defer backdropCancel()
+
+	merged, cancel := mergeContext(context.Background(), backdropCtx)
+	cancel()
+
+	select {
+	case <-merged.Done():
+	default:
+		t.Error("expected canceling the returned CancelFunc to close the merged context's Done channel")
+	}
+}
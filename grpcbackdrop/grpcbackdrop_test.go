@@ -0,0 +1,51 @@
+package grpcbackdrop_test
+
+import (
+	"net/http"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/husobee/backdrop"
+	"github.com/husobee/backdrop/grpcbackdrop"
+)
+
+func TestUnaryServerInterceptorRoundTripsAndEvicts(t *testing.T) {
+	backdrop.Start(nil)
+	interceptor := grpcbackdrop.UnaryServerInterceptor()
+
+	var handlerRan bool
+	var sawRequest *http.Request
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		handlerRan = true
+		r, ok := grpcbackdrop.RequestFromContext(ctx)
+		if !ok {
+			t.Fatal("expected RequestFromContext to find the synthetic request installed by the interceptor")
+		}
+		sawRequest = r
+		if err := backdrop.Set(r, "key", "value"); err != nil {
+			t.Fatal("failed to set a value on the synthetic request: ", err)
+		}
+		return "reply", nil
+	}
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/svc.Example/Method"}
+	reply, err := interceptor(context.Background(), "request", info, handler)
+	if err != nil {
+		t.Fatalf("interceptor returned an error: %v", err)
+	}
+	if reply != "reply" {
+		t.Errorf("expected the handler's reply to pass through, got %v", reply)
+	}
+	if !handlerRan {
+		t.Fatal("handler never ran")
+	}
+	if sawRequest == nil {
+		t.Fatal("expected a synthetic request to be reachable from the handler's context")
+	}
+
+	if _, err := backdrop.Get(sawRequest, "key"); err == nil {
+		t.Error("expected the synthetic request's context to have been evicted once the RPC returned, leaving the value unreachable")
+	}
+}
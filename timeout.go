@@ -0,0 +1,93 @@
+// Copyright 2015 - Husobee Associates, LLC.  All rights reserved.
+// Use of this source code is governed by The MIT License, which can be found
+// in the LICENSE file included.
+
+package backdrop
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// WithTimeout - derive a request's context with a timeout, the same way
+// context.WithTimeout does, and store the derived context back onto the
+// request.  The returned CancelFunc should be called as soon as the
+// operations it guards are done, to release resources early.
+func WithTimeout(r *http.Request, d time.Duration) (context.CancelFunc, error) {
+	ctx, cancel := context.WithTimeout(GetContext(r), d)
+	if err := SetContext(r, ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+	return cancel, nil
+}
+
+// WithDeadline - derive a request's context with a deadline, the same way
+// context.WithDeadline does, and store the derived context back onto the
+// request.
+func WithDeadline(r *http.Request, t time.Time) (context.CancelFunc, error) {
+	ctx, cancel := context.WithDeadline(GetContext(r), t)
+	if err := SetContext(r, ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+	return cancel, nil
+}
+
+// WithCancel - derive a request's context with a CancelFunc, the same way
+// context.WithCancel does, and store the derived context back onto the
+// request.
+func WithCancel(r *http.Request) (context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(GetContext(r))
+	if err := SetContext(r, ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+	return cancel, nil
+}
+
+// Done - the Done channel of the request's context, so handlers can select
+// on it the same way they would select on ctx.Done().
+func Done(r *http.Request) <-chan struct{} {
+	return GetContext(r).Done()
+}
+
+// Err - the Err of the request's context; non-nil once Done is closed.
+func Err(r *http.Request) error {
+	return GetContext(r).Err()
+}
+
+// timeoutHandler - Handler that installs a timeout context before calling
+// the wrapped handler, and tears it down afterward
+type timeoutHandler struct {
+	h http.Handler
+	d time.Duration
+}
+
+// TimeoutHandler - Wrapper Handler that installs a per-request timeout
+// context before invoking the wrapped handler, and cancels it on return.
+// Handlers can then use the standard
+//
+//	select {
+//	case <-backdrop.Done(r):
+//	        return backdrop.Err(r)
+//	case ...:
+//	}
+//
+// pattern without having to build their own cancel plumbing.
+func TimeoutHandler(h http.Handler, d time.Duration) http.Handler {
+	return &timeoutHandler{h: h, d: d}
+}
+
+// ServeHTTP - implementation of http.Handler
+func (th *timeoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cancel, err := WithTimeout(r, th.d)
+	if err != nil {
+		th.h.ServeHTTP(w, r)
+		return
+	}
+	defer cancel()
+	th.h.ServeHTTP(w, r)
+}
@@ -0,0 +1,74 @@
+package backdrop_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/husobee/backdrop"
+)
+
+func TestTimeoutHandlerCancelsOnTimeout(t *testing.T) {
+	backdrop.Start(nil)
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	var sawDone bool
+	var handler http.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
+		<-backdrop.Done(r)
+		sawDone = true
+		if backdrop.Err(r) == nil {
+			t.Error("expected a non-nil Err after Done was closed")
+		}
+	}
+
+	backdrop.TimeoutHandler(handler, time.Millisecond).ServeHTTP(w, r)
+
+	if !sawDone {
+		t.Error("handler never observed Done being closed")
+	}
+
+	backdrop.Evict(r)
+}
+
+func TestWithDeadlineClosesDoneAtDeadline(t *testing.T) {
+	backdrop.Start(nil)
+	r, _ := http.NewRequest("GET", "/", nil)
+	defer backdrop.Evict(r)
+
+	cancel, err := backdrop.WithDeadline(r, time.Now().Add(time.Millisecond))
+	if err != nil {
+		t.Fatal("failed to set up deadline: ", err)
+	}
+	defer cancel()
+
+	<-backdrop.Done(r)
+	if backdrop.Err(r) == nil {
+		t.Error("expected a non-nil Err once the deadline passed")
+	}
+}
+
+func TestWithCancelClosesDoneWhenCalled(t *testing.T) {
+	backdrop.Start(nil)
+	r, _ := http.NewRequest("GET", "/", nil)
+	defer backdrop.Evict(r)
+
+	cancel, err := backdrop.WithCancel(r)
+	if err != nil {
+		t.Fatal("failed to set up cancel: ", err)
+	}
+
+	select {
+	case <-backdrop.Done(r):
+		t.Fatal("did not expect Done to be closed before cancel was called")
+	default:
+	}
+
+	cancel()
+
+	<-backdrop.Done(r)
+	if backdrop.Err(r) == nil {
+		t.Error("expected a non-nil Err after calling cancel")
+	}
+}